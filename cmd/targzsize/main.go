@@ -1,10 +1,15 @@
 // Command targzsize computes the total unpacked size of a set of tar.gz archives.
 //
-//   targzsize [-legal] [-no-progress] [-human] path [path...]
+//   targzsize [-legal] [-no-progress] [-human] [-format codec] [-jobs N] [-report mode] path [path...]
 //
 // Targzsize iterates over the provides paths and computes the unpacked size of each file within the packages archives.
 // It then adds these totals together and outputs it to standard output.
 //
+// A path may also be "-" for standard input, or an http://, https:// or s3:// URL; these are
+// streamed through the same pipeline without ever being written to disk. http(s) sources resume
+// with a Range request if the connection drops partway through; s3 sources are fetched using the
+// default AWS credential chain.
+//
 // By default, targzsize writes status messages to standard error.
 // Pass the '-no-progress' flag to prevent this.
 //
@@ -12,14 +17,30 @@
 // To instead use human readable units, pass the '-human' flag.
 // This flag also applies to status messages.
 //
+// By default, the compression codec of each archive is auto-detected from its magic bytes,
+// supporting gzip, zstd, xz, bzip2, and plain (uncompressed) tar. Pass '-format' with one of
+// 'gzip', 'zstd', 'xz', 'bzip2' or 'tar' to force a specific codec, for example when reading
+// from a pipe or a file with corrupted magic bytes.
+//
+// When multiple paths are given, they are processed concurrently across a bounded worker pool.
+// By default this pool is sized to the number of CPUs; pass '-jobs' to override it.
+//
+// The '-report' flag selects the output format ('-format' was already taken by the codec
+// selector above, so the output mode gets its own flag instead). 'text' (the default) prints
+// the running and final totals described above. 'json' emits one JSON object per archive, once
+// it has been fully scanned, containing its summary and the full list of its entries. 'ndjson'
+// streams one JSON record per tar entry as it is scanned, followed by a summary record per
+// archive; this is suitable for piping into tools such as jq or a log ingestion pipeline. Both
+// 'json' and 'ndjson' imply '-no-progress' and write to standard output.
+//
 // The '-legal' flag can be used to print legal and licensing information.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
-	"math/big"
 	"os"
 
 	"github.com/tkw1536/targzsize"
@@ -27,6 +48,9 @@ import (
 
 var silentFlag bool
 var humanFlag bool
+var formatFlag string
+var jobsFlag int
+var reportFlag string
 
 func main() {
 	// get list of files
@@ -35,17 +59,45 @@ func main() {
 		log.Fatal("Need at least one file. ")
 	}
 
-	// handle all the files
-	var total big.Int
-	for _, filepath := range files {
-		if err := targzsize.MainFile(filepath, &total, silentFlag, humanFlag); err != nil {
-			log.Fatalf("Error processing %s: %s\n", filepath, err)
-			return
+	scanner := &targzsize.Scanner{
+		Jobs:   jobsFlag,
+		Format: targzsize.Format(formatFlag),
+		Silent: silentFlag,
+		Human:  humanFlag,
+	}
+
+	switch reportFlag {
+	case "text":
+		// use the default status lines and summary below
+	case "json":
+		scanner.Reporter = targzsize.NewJSONReporter(os.Stdout)
+		scanner.Silent = true
+	case "ndjson":
+		scanner.Reporter = targzsize.NewNDJSONReporter(os.Stdout)
+		scanner.Silent = true
+	default:
+		log.Fatalf("Unknown -report value %q, must be one of text, json, ndjson", reportFlag)
+	}
+
+	// process all the files, in parallel
+	totals, err := scanner.Run(context.Background(), files)
+	if err != nil {
+		log.Fatalf("Error processing archives: %s\n", err)
+	}
+
+	if reportFlag != "text" {
+		return
+	}
+
+	// report per-archive totals, in the original argument order
+	if !silentFlag {
+		for i, filepath := range files {
+			log.Printf("%s: %s\n", filepath, targzsize.TotalToString(totals[i], humanFlag))
 		}
 	}
 
-	// and write the total
-	log.Printf("%s\n", targzsize.TotalToString(&total, humanFlag))
+	// and write the combined total
+	log.Printf("%s\n", targzsize.TotalToString(scanner.Total(), humanFlag))
 }
 
 func init() {
@@ -63,4 +115,8 @@ func init() {
 
 	flag.BoolVar(&silentFlag, "no-progress", silentFlag, "Don't output status messages to stderr")
 	flag.BoolVar(&humanFlag, "human", humanFlag, "Output human units instead of bytes")
+	flag.StringVar(&formatFlag, "format", formatFlag, "Force a specific compression codec (gzip, zstd, xz, bzip2, tar) instead of auto-detecting it")
+	flag.IntVar(&jobsFlag, "jobs", jobsFlag, "Maximum number of archives to process concurrently (default: number of CPUs)")
+	// Named "-report" rather than "-format" to avoid colliding with the codec selector above.
+	flag.StringVar(&reportFlag, "report", "text", "Output format: text, json, or ndjson")
 }
@@ -0,0 +1,114 @@
+package targzsize
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// Format identifies a compression codec used to wrap a tar stream.
+type Format string
+
+// Supported values for Format.
+// FormatAuto instructs DetectDecompressor to sniff the codec from the stream itself.
+const (
+	FormatAuto  Format = ""
+	FormatGzip  Format = "gzip"
+	FormatZstd  Format = "zstd"
+	FormatXz    Format = "xz"
+	FormatBzip2 Format = "bzip2"
+	FormatTar   Format = "tar"
+)
+
+// sniffLen is the number of bytes needed to recognize the longest magic number below.
+const sniffLen = 6
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic    = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
+	bzip2Magic = []byte{0x42, 0x5a, 0x68}
+)
+
+// DetectDecompressor peeks at the first bytes of r to determine which compression codec it was
+// written with, and returns a reader that yields the decompressed tar stream, along with the name
+// of the detected codec.
+//
+// When r does not start with any of the known magic numbers, it is assumed to already be a plain
+// tar stream, and is returned unchanged.
+//
+// The returned io.ReadCloser must be closed once the caller is done reading from it: codecs such
+// as zstd start background goroutines that are only released on Close.
+func DetectDecompressor(r io.Reader) (io.ReadCloser, string, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, "", errors.Wrap(err, "Unable to read magic bytes")
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return openFormat(br, FormatGzip)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return openFormat(br, FormatZstd)
+	case bytes.HasPrefix(magic, xzMagic):
+		return openFormat(br, FormatXz)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return openFormat(br, FormatBzip2)
+	default:
+		return openFormat(br, FormatTar)
+	}
+}
+
+// OpenDecompressor returns a reader that yields the decompressed tar stream contained in r.
+//
+// When format is FormatAuto, the codec is determined automatically using DetectDecompressor.
+// Otherwise r is assumed to be encoded using the given format.
+//
+// The returned io.ReadCloser must be closed once the caller is done reading from it: codecs such
+// as zstd start background goroutines that are only released on Close.
+func OpenDecompressor(r io.Reader, format Format) (io.ReadCloser, string, error) {
+	if format == FormatAuto {
+		return DetectDecompressor(r)
+	}
+	return openFormat(r, format)
+}
+
+// openFormat wraps r with the decompressor belonging to format.
+//
+// Codecs that don't own any closeable resource of their own (xz, bzip2, and the raw tar
+// passthrough) are wrapped with io.NopCloser, so callers can always treat the result uniformly.
+func openFormat(r io.Reader, format Format) (io.ReadCloser, string, error) {
+	switch format {
+	case FormatGzip:
+		gzf, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Unable to create gzip reader")
+		}
+		return gzf, string(FormatGzip), nil
+	case FormatZstd:
+		zf, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Unable to create zstd reader")
+		}
+		return zf.IOReadCloser(), string(FormatZstd), nil
+	case FormatXz:
+		xzf, err := xz.NewReader(r)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Unable to create xz reader")
+		}
+		return io.NopCloser(xzf), string(FormatXz), nil
+	case FormatBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), string(FormatBzip2), nil
+	case FormatTar:
+		return io.NopCloser(r), string(FormatTar), nil
+	default:
+		return nil, "", errors.Errorf("Unknown format %q", format)
+	}
+}
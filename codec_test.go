@@ -0,0 +1,120 @@
+package targzsize
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// plainTar returns a minimal, valid tar stream containing a single regular file named name.
+func plainTar(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(content)), Mode: 0o644}); err != nil {
+		t.Fatalf("WriteHeader: %v", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectDecompressor(t *testing.T) {
+	raw := plainTar(t, "hello.txt", []byte("hello world"))
+
+	gzipBuf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(gzipBuf)
+	gzw.Write(raw)
+	gzw.Close()
+
+	zstdBuf := &bytes.Buffer{}
+	zstdw, err := zstd.NewWriter(zstdBuf)
+	if err != nil {
+		t.Fatalf("zstd.NewWriter: %v", err)
+	}
+	zstdw.Write(raw)
+	zstdw.Close()
+
+	xzBuf := &bytes.Buffer{}
+	xzw, err := xz.NewWriter(xzBuf)
+	if err != nil {
+		t.Fatalf("xz.NewWriter: %v", err)
+	}
+	xzw.Write(raw)
+	xzw.Close()
+
+	tests := []struct {
+		name     string
+		input    []byte
+		wantName string
+	}{
+		{"gzip", gzipBuf.Bytes(), string(FormatGzip)},
+		{"zstd", zstdBuf.Bytes(), string(FormatZstd)},
+		{"xz", xzBuf.Bytes(), string(FormatXz)},
+		{"plain tar", raw, string(FormatTar)},
+		{"empty input", nil, string(FormatTar)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, name, err := DetectDecompressor(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("DetectDecompressor: %v", err)
+			}
+			if name != tt.wantName {
+				t.Fatalf("got codec %q, want %q", name, tt.wantName)
+			}
+
+			tr := tar.NewReader(r)
+			header, err := tr.Next()
+			if err != nil {
+				if tt.input == nil && err == io.EOF {
+					return
+				}
+				t.Fatalf("tar.Next: %v", err)
+			}
+			if header.Name != "hello.txt" {
+				t.Fatalf("got entry %q, want %q", header.Name, "hello.txt")
+			}
+		})
+	}
+}
+
+func TestDetectDecompressorBzip2(t *testing.T) {
+	// compress/bzip2 only ships a reader, so exercise detection with a canned bzip2 stream
+	// (produced by the standard "bzip2" command line tool) for a single "A" byte.
+	canned := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x81, 0xb0,
+		0x2d, 0x8b, 0x00, 0x00, 0x00, 0x04, 0x00, 0x20, 0x00, 0x20, 0x00, 0x21,
+		0x18, 0x46, 0x82, 0xee, 0x48, 0xa7, 0x0a, 0x12, 0x10, 0x36, 0x05, 0xb1,
+		0x60,
+	}
+
+	// The canned payload is not a tar stream, so read the decompressed bytes directly instead
+	// of going through tar.Reader as the test above does.
+	r, name, err := DetectDecompressor(bytes.NewReader(canned))
+	if err != nil {
+		t.Fatalf("DetectDecompressor: %v", err)
+	}
+	if name != string(FormatBzip2) {
+		t.Fatalf("got codec %q, want %q", name, string(FormatBzip2))
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "A" {
+		t.Fatalf("got payload %q, want %q", got, "A")
+	}
+}
@@ -3,13 +3,14 @@ package targzsize
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"math/big"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
@@ -30,14 +31,17 @@ func TotalToString(value *big.Int, human bool) string {
 const chanBufferSize = 100
 
 // MainFile handles a single file, adding the total to total.
-func MainFile(filepath string, total *big.Int, silent bool, human bool) error {
+// format selects the compression codec to use; pass FormatAuto to detect it from the file itself.
+//
+// MainFile stops promptly once ctx is cancelled.
+func MainFile(ctx context.Context, filepath string, format Format, total *big.Int, silent bool, human bool) error {
 	if !silent {
 		log.Printf("Reading %s\n", filepath)
 	}
 	lines := make(chan StatusLine, chanBufferSize)
 	items := make(chan Item, chanBufferSize)
 
-	resultChan := ProcessFile(filepath, items)
+	resultChan := openArchive(ctx, filepath, format, items, silent)
 	countCtx := AddItems(total, items, lines, silent)
 	writerCtx := WriteLines(lines, human)
 
@@ -72,9 +76,34 @@ func WriteLines(lines <-chan StatusLine, human bool) context.Context {
 }
 
 // Item represents an item inside a tar.gz file.
+// The fields beyond Path and Size mirror the corresponding tar.Header fields, and are
+// populated for every entry regardless of Typeflag; they exist so that a Reporter can
+// describe an entry in full, without needing access to the underlying tar.Header.
 type Item struct {
-	Path string
-	Size int64
+	Path     string
+	Size     int64
+	Typeflag byte
+	Mode     int64
+	ModTime  time.Time
+	Linkname string
+
+	// Layer names the OCI layer blob (relative to the image layout) whose copy of Path
+	// survived flattening. It is set only for items produced by ProcessOCIArchive; every
+	// other source leaves it empty.
+	Layer string
+}
+
+// toEntryRecord converts item into the structured representation consumed by a Reporter.
+func (item Item) toEntryRecord() EntryRecord {
+	return EntryRecord{
+		Name:     item.Path,
+		Size:     item.Size,
+		Typeflag: string(item.Typeflag),
+		Mode:     item.Mode,
+		ModTime:  item.ModTime,
+		Linkname: item.Linkname,
+		Layer:    item.Layer,
+	}
 }
 
 // AddItems keeps addding to dest from channel values.
@@ -105,36 +134,88 @@ func AddItems(dest *big.Int, items <-chan Item, lines chan<- StatusLine, silent
 	return ctx
 }
 
-// ProcessFile processes file, writing the size of each chunk containined in it to values.
-// Furthermore writes a log message to logChan.
+// openArchive processes source, which may be a local path, a "-" for standard input, or an
+// http(s):// or s3:// URL streamed without buffering to disk.
+//
+// Local paths that look like an OCI or `docker save` image archive are dispatched to
+// ProcessOCIArchive; everything else is dispatched to ProcessReader. silent suppresses
+// ProcessOCIArchive's per-layer log lines, matching the progress output it is paired with.
+func openArchive(ctx context.Context, source string, format Format, items chan<- Item, silent bool) <-chan error {
+	switch {
+	case source == "-":
+		return ProcessReader(ctx, "stdin", os.Stdin, format, items)
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return processHTTP(ctx, source, format, items)
+	case strings.HasPrefix(source, "s3://"):
+		return processS3(ctx, source, format, items)
+	}
+
+	if isOCI, err := IsOCIArchive(source); err == nil && isOCI {
+		return ProcessOCIArchive(ctx, source, items, silent)
+	}
+	return ProcessFile(ctx, source, format, items)
+}
+
+// ProcessFile processes the file at filepath, writing the size of each entry it contains to
+// items.
+//
+// format selects the compression codec to use; pass FormatAuto to detect it from the file itself.
+//
+// ProcessFile stops scanning and returns ctx.Err() promptly once ctx is cancelled.
 //
 // When an error occcurs, calls log.Fattalf.
 //
 // Returns a channel that receives the error from this function
-func ProcessFile(filepath string, items chan<- Item) <-chan error {
+func ProcessFile(ctx context.Context, filepath string, format Format, items chan<- Item) <-chan error {
+	file, err := os.Open(filepath)
+	if err != nil {
+		errChan := make(chan error, 1)
+		errChan <- errors.Wrapf(err, "Unable to open %s", filepath)
+		close(errChan)
+		close(items)
+		return errChan
+	}
+
+	resultChan := ProcessReader(ctx, filepath, file, format, items)
+
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		err := <-resultChan
+		file.Close()
+		errChan <- err
+	}()
+	return errChan
+}
+
+// ProcessReader processes the tar stream read from r, writing the size of each entry it
+// contains to items. name is used only to annotate error messages, and need not be a real
+// path; this is what decouples ProcessReader from the file system, allowing archives to be
+// streamed from any source (a local file, standard input, or a remote URL).
+//
+// format selects the compression codec to use; pass FormatAuto to detect it from r itself.
+//
+// ProcessReader stops scanning and returns ctx.Err() promptly once ctx is cancelled.
+//
+// Returns a channel that receives the error from this function. ProcessReader does not close r;
+// callers that opened it are responsible for closing it once the returned channel is closed.
+func ProcessReader(ctx context.Context, name string, r io.Reader, format Format, items chan<- Item) <-chan error {
 	errChan := make(chan error, 1)
 
 	go func() {
 		defer close(errChan)
 		defer close(items)
 
-		// Open the file
-		file, err := os.Open(filepath)
-		if err != nil {
-			errChan <- errors.Wrapf(err, "Unable to open %s", filepath)
-			return
-		}
-		defer file.Close()
-
-		// make a gzip reader
-		gzf, err := gzip.NewReader(file)
+		// detect (or force) the compression codec and unwrap it
+		tgzr, _, err := OpenDecompressor(r, format)
 		if err != nil {
-			errChan <- errors.Wrapf(err, "Unable to create gzip reader")
+			errChan <- errors.Wrapf(err, "Unable to open decompressor for %s", name)
 			return
 		}
+		defer tgzr.Close()
 
 		// make a tar reader
-		tgz := tar.NewReader(gzf)
+		tgz := tar.NewReader(tgzr)
 		if tgz == nil {
 			errChan <- errors.New("Unable to create tar reader")
 			return
@@ -142,28 +223,34 @@ func ProcessFile(filepath string, items chan<- Item) <-chan error {
 
 		// iterate over the file
 		for {
+			select {
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			default:
+			}
+
 			header, err := tgz.Next()
 			if err == io.EOF {
 				break
 			}
 
 			if err != nil {
-				errChan <- errors.Wrap(err, "Error scanning tarfile")
+				errChan <- errors.Wrapf(err, "Error scanning %s", name)
 				return
 			}
 
-			switch header.Typeflag {
-			case tar.TypeReg:
-				items <- Item{
-					Size: header.Size,
-					Path: header.Name,
-				}
-			default:
-				items <- Item{
-					Size: 0,
-					Path: header.Name,
-				}
+			item := Item{
+				Path:     header.Name,
+				Typeflag: header.Typeflag,
+				Mode:     header.Mode,
+				ModTime:  header.ModTime,
+				Linkname: header.Linkname,
+			}
+			if header.Typeflag == tar.TypeReg {
+				item.Size = header.Size
 			}
+			items <- item
 		}
 
 	}()
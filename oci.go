@@ -0,0 +1,422 @@
+package targzsize
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// whiteoutPrefix marks a file as an AUFS-style whiteout, recording that the sibling file of
+// the same name (with this prefix stripped) was deleted in this layer.
+const whiteoutPrefix = ".wh."
+
+// whiteoutOpaqueMarker marks a directory as opaque, meaning every entry beneath it contributed
+// by earlier layers is hidden, even though the directory itself is not deleted.
+const whiteoutOpaqueMarker = ".wh..wh..opq"
+
+// ociLayoutMarker is the file that, together with index.json, identifies an OCI image layout.
+const ociLayoutMarker = "oci-layout"
+
+// dockerManifestEntry describes a single image within a `docker save` manifest.json.
+type dockerManifestEntry struct {
+	Config string   `json:"Config"`
+	Layers []string `json:"Layers"`
+}
+
+// ociDescriptor is a content-addressable reference into an OCI image layout, as used by both
+// index.json and an image manifest.
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// ociIndex is the top-level index.json of an OCI image layout.
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is the image manifest referenced by an ociIndex entry.
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// IsOCIArchive reports whether archivePath looks like an OCI image layout or a `docker save`
+// tarball, based on the presence of manifest.json, or index.json alongside oci-layout, among
+// its top-level entries.
+//
+// IsOCIArchive only reads tar headers, never entry bodies, so it is far cheaper than the
+// extraction pass ProcessOCIArchive performs afterwards; it still has to scan every header in
+// the archive to conclusively rule out a negative, but returns as soon as detection succeeds.
+func IsOCIArchive(archivePath string) (bool, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to open %s", archivePath)
+	}
+	defer file.Close()
+
+	r, _, err := DetectDecompressor(file)
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to open decompressor for %s", archivePath)
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	var hasManifest, hasIndex, hasLayout bool
+	for {
+		if hasManifest || (hasIndex && hasLayout) {
+			return true, nil
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "Error scanning tarfile")
+		}
+
+		switch path.Clean("/" + header.Name) {
+		case "/manifest.json":
+			hasManifest = true
+		case "/index.json":
+			hasIndex = true
+		case "/" + ociLayoutMarker:
+			hasLayout = true
+		}
+	}
+
+	return false, nil
+}
+
+// ociPathState is the effective, flattened state of a single path after applying every layer
+// processed so far.
+type ociPathState struct {
+	item    Item
+	layer   string
+	deleted bool
+}
+
+// ProcessOCIArchive processes archivePath as an OCI image layout or `docker save` tarball.
+// It extracts the outer archive to a temporary directory, recursively descends into each
+// layer blob referenced by the image's manifest (in application order), and writes one Item
+// per path of the resulting flattened filesystem to items.
+//
+// Whiteout files (entries whose base name starts with ".wh.") remove the corresponding path
+// of earlier layers from the effective filesystem instead of being counted themselves, so that
+// deleted files do not inflate the total unpacked size.
+//
+// Each layer blob is read using DetectDecompressor, so it may independently be gzip, zstd, xz,
+// bzip2, or an uncompressed tar.
+//
+// Besides the flattened Items, ProcessOCIArchive logs the effective, post-flattening size and
+// file count contributed by every layer, in application order, unless silent is set; items sent
+// to the Scanner's Reporter (if any) also carry this breakdown via Item.Layer and
+// ArchiveSummary.Layers regardless of silent.
+//
+// ProcessOCIArchive stops extracting and returns ctx.Err() promptly once ctx is cancelled.
+func ProcessOCIArchive(ctx context.Context, archivePath string, items chan<- Item, silent bool) <-chan error {
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(errChan)
+		defer close(items)
+
+		dir, err := os.MkdirTemp("", "targzsize-oci-")
+		if err != nil {
+			errChan <- errors.Wrap(err, "Unable to create temporary directory")
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		if err := extractTar(ctx, archivePath, dir); err != nil {
+			errChan <- err
+			return
+		}
+
+		layers, err := ociLayerBlobs(dir)
+		if err != nil {
+			errChan <- err
+			return
+		}
+
+		states := make(map[string]*ociPathState)
+		for _, layer := range layers {
+			if !silent {
+				log.Printf("Reading layer %s\n", layer)
+			}
+			if err := applyLayer(ctx, dir, layer, states); err != nil {
+				errChan <- err
+				return
+			}
+		}
+
+		paths := make([]string, 0, len(states))
+		for name := range states {
+			paths = append(paths, name)
+		}
+		sort.Strings(paths)
+
+		layerTotals := make(map[string]*layerTotal, len(layers))
+		for _, name := range paths {
+			state := states[name]
+			if state.deleted {
+				continue
+			}
+			items <- state.item
+
+			if total, ok := layerTotals[state.layer]; ok {
+				total.size += state.item.Size
+				total.files++
+			} else {
+				layerTotals[state.layer] = &layerTotal{size: state.item.Size, files: 1}
+			}
+		}
+
+		// log the effective, post-flattening contribution of every layer, in application
+		// order, even for layers every one of whose entries was later overwritten or deleted.
+		if !silent {
+			for _, layer := range layers {
+				total := layerTotals[layer]
+				if total == nil {
+					total = &layerTotal{}
+				}
+				log.Printf("Layer %s: %s (%d files)\n", layer, TotalToString(big.NewInt(total.size), false), total.files)
+			}
+		}
+	}()
+
+	return errChan
+}
+
+// layerTotal aggregates the size and file count of the entries of a single OCI layer that
+// survived flattening.
+type layerTotal struct {
+	size  int64
+	files int
+}
+
+// extractTar decompresses and unpacks the tar archive at archivePath into dir.
+//
+// extractTar stops extracting and returns ctx.Err() promptly once ctx is cancelled.
+func extractTar(ctx context.Context, archivePath string, dir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", archivePath)
+	}
+	defer file.Close()
+
+	r, _, err := DetectDecompressor(file)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open decompressor for %s", archivePath)
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "Error scanning tarfile")
+		}
+
+		// Clean the name before joining it onto dir, so a maliciously crafted archive
+		// cannot write outside of it.
+		target := filepath.Join(dir, filepath.Clean(string(filepath.Separator)+header.Name))
+
+		if header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return errors.Wrapf(err, "Unable to create %s", target)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return errors.Wrapf(err, "Unable to create %s", filepath.Dir(target))
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to create %s", target)
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return errors.Wrapf(err, "Unable to write %s", target)
+		}
+	}
+}
+
+// ociLayerBlobs returns the paths, relative to dir, of every layer blob referenced by the
+// image extracted into dir, in application order.
+func ociLayerBlobs(dir string) ([]string, error) {
+	if data, err := os.ReadFile(filepath.Join(dir, "manifest.json")); err == nil {
+		var manifests []dockerManifestEntry
+		if err := json.Unmarshal(data, &manifests); err != nil {
+			return nil, errors.Wrap(err, "Unable to parse manifest.json")
+		}
+
+		var layers []string
+		for _, manifest := range manifests {
+			layers = append(layers, manifest.Layers...)
+		}
+		return layers, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ociLayoutMarker)); err != nil {
+		return nil, errors.New("Not an OCI image archive: missing manifest.json or oci-layout")
+	}
+	return ociLayoutLayerBlobs(dir)
+}
+
+// ociLayoutLayerBlobs returns the layer blob paths of the first image described by the
+// index.json of the OCI image layout extracted into dir.
+func ociLayoutLayerBlobs(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read index.json")
+	}
+
+	var index ociIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse index.json")
+	}
+	if len(index.Manifests) == 0 {
+		return nil, errors.New("index.json contains no manifests")
+	}
+
+	manifestRel, err := ociBlobPath(index.Manifests[0].Digest)
+	if err != nil {
+		return nil, err
+	}
+	manifestData, err := os.ReadFile(filepath.Join(dir, manifestRel))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read %s", manifestRel)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse image manifest")
+	}
+
+	layers := make([]string, len(manifest.Layers))
+	for i, layer := range manifest.Layers {
+		rel, err := ociBlobPath(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		layers[i] = rel
+	}
+	return layers, nil
+}
+
+// ociBlobPath turns a "<algorithm>:<hash>" content digest into its path within an OCI image
+// layout, relative to the layout root.
+func ociBlobPath(digest string) (string, error) {
+	algorithm, hash, ok := strings.Cut(digest, ":")
+	if !ok {
+		return "", errors.Errorf("Invalid digest %q", digest)
+	}
+	return filepath.Join("blobs", algorithm, hash), nil
+}
+
+// applyLayer reads the layer blob at dir/layerRel, updating states to reflect its effect on
+// the flattened filesystem: regular entries overwrite any earlier state for the same path,
+// and whiteout entries mark the path (and, for opaque whiteouts, every path beneath it) as
+// deleted.
+//
+// applyLayer stops scanning and returns ctx.Err() promptly once ctx is cancelled.
+func applyLayer(ctx context.Context, dir string, layerRel string, states map[string]*ociPathState) error {
+	full := filepath.Join(dir, layerRel)
+	file, err := os.Open(full)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open layer %s", layerRel)
+	}
+	defer file.Close()
+
+	r, _, err := DetectDecompressor(file)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open decompressor for layer %s", layerRel)
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error scanning layer %s", layerRel)
+		}
+
+		name := path.Clean("/" + header.Name)
+		base := path.Base(name)
+
+		if base == whiteoutOpaqueMarker {
+			markDeletedBeneath(states, path.Dir(name))
+			continue
+		}
+
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			removed := path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix))
+			markDeleted(states, removed)
+			markDeletedBeneath(states, removed)
+			continue
+		}
+
+		item := Item{
+			Path:     name,
+			Typeflag: header.Typeflag,
+			Mode:     header.Mode,
+			ModTime:  header.ModTime,
+			Linkname: header.Linkname,
+			Layer:    layerRel,
+		}
+		if header.Typeflag == tar.TypeReg {
+			item.Size = header.Size
+		}
+		states[name] = &ociPathState{item: item, layer: layerRel}
+	}
+}
+
+// markDeleted marks name as deleted, recording a placeholder state if none exists yet.
+func markDeleted(states map[string]*ociPathState, name string) {
+	if state, ok := states[name]; ok {
+		state.deleted = true
+		return
+	}
+	states[name] = &ociPathState{deleted: true}
+}
+
+// markDeletedBeneath marks every known path beneath dir (exclusive) as deleted.
+func markDeletedBeneath(states map[string]*ociPathState, dir string) {
+	prefix := dir + "/"
+	for name, state := range states {
+		if strings.HasPrefix(name, prefix) {
+			state.deleted = true
+		}
+	}
+}
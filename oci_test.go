@@ -0,0 +1,144 @@
+package targzsize
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry describes a single entry to write with writeTarLayer.
+type tarEntry struct {
+	name    string
+	content string
+}
+
+// writeTarLayer writes an uncompressed tar containing entries to dir/rel, creating any parent
+// directories of rel as needed.
+func writeTarLayer(t *testing.T, dir, rel string, entries []tarEntry) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: e.name,
+			Size: int64(len(e.content)),
+			Mode: 0o644,
+		}); err != nil {
+			t.Fatalf("WriteHeader(%s): %v", e.name, err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatalf("Write(%s): %v", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	full := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(full, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// survivors returns the paths of every non-deleted entry in states, for easy comparison.
+func survivors(states map[string]*ociPathState) map[string]bool {
+	out := make(map[string]bool)
+	for name, state := range states {
+		if !state.deleted {
+			out[name] = true
+		}
+	}
+	return out
+}
+
+func TestApplyLayerWhiteout(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTarLayer(t, dir, "layer1.tar", []tarEntry{
+		{name: "a.txt", content: "aaa"},
+		{name: "b.txt", content: "bb"},
+	})
+	writeTarLayer(t, dir, "layer2.tar", []tarEntry{
+		{name: ".wh.a.txt"},
+		{name: "c.txt", content: "c"},
+	})
+
+	states := make(map[string]*ociPathState)
+	if err := applyLayer(context.Background(), dir, "layer1.tar", states); err != nil {
+		t.Fatalf("applyLayer(layer1): %v", err)
+	}
+	if err := applyLayer(context.Background(), dir, "layer2.tar", states); err != nil {
+		t.Fatalf("applyLayer(layer2): %v", err)
+	}
+
+	got := survivors(states)
+	want := map[string]bool{"/b.txt": true, "/c.txt": true}
+	if len(got) != len(want) {
+		t.Fatalf("got survivors %v, want %v", got, want)
+	}
+	for name := range want {
+		if !got[name] {
+			t.Errorf("expected %s to survive, got %v", name, got)
+		}
+	}
+	if states["/a.txt"] == nil || !states["/a.txt"].deleted {
+		t.Errorf("expected /a.txt to be marked deleted by the whiteout")
+	}
+	if got := states["/c.txt"].layer; got != "layer2.tar" {
+		t.Errorf("got layer %q for /c.txt, want %q", got, "layer2.tar")
+	}
+}
+
+func TestApplyLayerOpaqueWhiteout(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTarLayer(t, dir, "layer1.tar", []tarEntry{
+		{name: "sub/keep.txt", content: "k"},
+		{name: "sub/drop.txt", content: "d"},
+	})
+	// The opaque marker must be scanned before sub/new.txt for the latter to survive: it only
+	// deletes entries already recorded in states at the time it is processed.
+	writeTarLayer(t, dir, "layer2.tar", []tarEntry{
+		{name: "sub/.wh..wh..opq"},
+		{name: "sub/new.txt", content: "n"},
+	})
+
+	states := make(map[string]*ociPathState)
+	if err := applyLayer(context.Background(), dir, "layer1.tar", states); err != nil {
+		t.Fatalf("applyLayer(layer1): %v", err)
+	}
+	if err := applyLayer(context.Background(), dir, "layer2.tar", states); err != nil {
+		t.Fatalf("applyLayer(layer2): %v", err)
+	}
+
+	got := survivors(states)
+	want := map[string]bool{"/sub/new.txt": true}
+	if len(got) != len(want) || !got["/sub/new.txt"] {
+		t.Fatalf("got survivors %v, want %v", got, want)
+	}
+	for _, name := range []string{"/sub/keep.txt", "/sub/drop.txt"} {
+		if states[name] == nil || !states[name].deleted {
+			t.Errorf("expected %s to be marked deleted by the opaque whiteout", name)
+		}
+	}
+}
+
+func TestApplyLayerRespectsContextCancellation(t *testing.T) {
+	dir := t.TempDir()
+	writeTarLayer(t, dir, "layer.tar", []tarEntry{{name: "a.txt", content: "a"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	states := make(map[string]*ociPathState)
+	if err := applyLayer(ctx, dir, "layer.tar", states); err != ctx.Err() {
+		t.Fatalf("got err %v, want %v", err, ctx.Err())
+	}
+}
@@ -0,0 +1,213 @@
+package targzsize
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+)
+
+// processHTTP streams the archive at url, resuming with a Range request if the connection is
+// dropped partway through.
+func processHTTP(ctx context.Context, url string, format Format, items chan<- Item) <-chan error {
+	r := newHTTPRangeReader(ctx, http.DefaultClient, url)
+	resultChan := ProcessReader(ctx, url, r, format, items)
+
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		err := <-resultChan
+		r.Close()
+		errChan <- err
+	}()
+	return errChan
+}
+
+// httpRangeReader streams the body of an HTTP(S) resource, transparently resuming with a
+// Range request rooted at the last byte read if the connection drops partway through.
+type httpRangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+
+	body   io.ReadCloser
+	offset int64
+}
+
+// newHTTPRangeReader returns an io.ReadCloser that lazily opens url on its first Read, and
+// transparently resumes the download with a Range request if it is interrupted.
+func newHTTPRangeReader(ctx context.Context, client *http.Client, url string) *httpRangeReader {
+	return &httpRangeReader{ctx: ctx, client: client, url: url}
+}
+
+// maxResumeAttempts bounds how many times Read will reopen the connection in a row without
+// making any progress, so a server that drops the connection immediately on every attempt
+// fails with an error instead of spinning on (0, nil) reads.
+const maxResumeAttempts = 5
+
+// Read implements io.Reader, transparently resuming the download as many times as needed to
+// make forward progress, up to maxResumeAttempts consecutive attempts that read no bytes.
+func (r *httpRangeReader) Read(p []byte) (int, error) {
+	for attempt := 0; ; attempt++ {
+		if r.body == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		// the connection was interrupted: drop it so that the next read resumes from r.offset.
+		r.body.Close()
+		r.body = nil
+		if n > 0 {
+			return n, nil
+		}
+
+		// no bytes were yielded: resume and retry, rather than returning (0, nil), which
+		// io.Reader forbids relying on and which callers such as bufio.Reader treat as a
+		// no-progress error after enough repetitions.
+		if attempt >= maxResumeAttempts {
+			return 0, errors.Wrapf(err, "Gave up resuming %s after %d attempts", r.url, attempt+1)
+		}
+	}
+}
+
+// open (re-)opens the request, using a Range header to resume from r.offset when it is non-zero.
+//
+// When resuming (r.offset > 0), the server must honor the Range header with a 206 Partial
+// Content response whose Content-Range starts at r.offset; a 200 response would silently
+// restart the body at byte 0 while the downstream decompressor has already consumed r.offset
+// bytes of the old stream, corrupting the result.
+func (r *httpRangeReader) open() error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create request for %s", r.url)
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to fetch %s", r.url)
+	}
+
+	if r.offset > 0 {
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return errors.Errorf("Server does not support resuming %s at offset %d: expected status 206, got %s", r.url, r.offset, resp.Status)
+		}
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != r.offset {
+			resp.Body.Close()
+			return errors.Errorf("Unexpected Content-Range %q resuming %s at offset %d", resp.Header.Get("Content-Range"), r.url, r.offset)
+		}
+	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return errors.Errorf("Unexpected status %s fetching %s", resp.Status, r.url)
+	}
+
+	r.body = resp.Body
+	return nil
+}
+
+// contentRangeStart parses the starting byte offset out of a Content-Range response header of
+// the form "bytes start-end/size", as returned alongside a 206 Partial Content response.
+func contentRangeStart(header string) (int64, bool) {
+	const prefix = "bytes "
+	if !strings.HasPrefix(header, prefix) {
+		return 0, false
+	}
+
+	rest := strings.TrimPrefix(header, prefix)
+	dash := strings.IndexByte(rest, '-')
+	if dash <= 0 {
+		return 0, false
+	}
+
+	start, err := strconv.ParseInt(rest[:dash], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// Close closes the underlying response body, if one is currently open.
+func (r *httpRangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// processS3 streams the archive at an s3://bucket/key URL using the AWS SDK's GetObject,
+// bound to ctx.
+func processS3(ctx context.Context, rawURL string, format Format, items chan<- Item) <-chan error {
+	bucket, key, err := parseS3URL(rawURL)
+	if err != nil {
+		return failedChan(items, err)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return failedChan(items, errors.Wrap(err, "Unable to load AWS configuration"))
+	}
+
+	out, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return failedChan(items, errors.Wrapf(err, "Unable to get %s", rawURL))
+	}
+
+	resultChan := ProcessReader(ctx, rawURL, out.Body, format, items)
+
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		err := <-resultChan
+		out.Body.Close()
+		errChan <- err
+	}()
+	return errChan
+}
+
+// parseS3URL splits an "s3://bucket/key" URL into its bucket and key.
+func parseS3URL(rawURL string) (bucket string, key string, err error) {
+	const prefix = "s3://"
+	trimmed := rawURL[len(prefix):]
+
+	slash := -1
+	for i, c := range trimmed {
+		if c == '/' {
+			slash = i
+			break
+		}
+	}
+	if slash <= 0 || slash == len(trimmed)-1 {
+		return "", "", errors.Errorf("Invalid s3 URL %q, expected s3://bucket/key", rawURL)
+	}
+
+	return trimmed[:slash], trimmed[slash+1:], nil
+}
+
+// failedChan returns a channel that immediately reports err, after closing items as
+// openArchive's other branches do.
+func failedChan(items chan<- Item, err error) <-chan error {
+	errChan := make(chan error, 1)
+	errChan <- err
+	close(errChan)
+	close(items)
+	return errChan
+}
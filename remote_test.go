@@ -0,0 +1,147 @@
+package targzsize
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseS3URL(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		wantBucket string
+		wantKey    string
+		wantErr    bool
+	}{
+		{"simple key", "s3://bucket/key", "bucket", "key", false},
+		{"nested key", "s3://bucket/a/b/c.tar.gz", "bucket", "a/b/c.tar.gz", false},
+		{"missing key", "s3://bucket/", "", "", true},
+		{"no path at all", "s3://bucket", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, key, err := parseS3URL(tt.url)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseS3URL(%q) succeeded, want error", tt.url)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseS3URL(%q): %v", tt.url, err)
+			}
+			if bucket != tt.wantBucket || key != tt.wantKey {
+				t.Fatalf("parseS3URL(%q) = (%q, %q), want (%q, %q)", tt.url, bucket, key, tt.wantBucket, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantStart int64
+		wantOK    bool
+	}{
+		{"bytes 5-9/10", 5, true},
+		{"bytes 0-0/1", 0, true},
+		{"", 0, false},
+		{"bytes */10", 0, false},
+		{"not-bytes 5-9/10", 0, false},
+	}
+
+	for _, tt := range tests {
+		start, ok := contentRangeStart(tt.header)
+		if ok != tt.wantOK || (ok && start != tt.wantStart) {
+			t.Errorf("contentRangeStart(%q) = (%d, %v), want (%d, %v)", tt.header, start, ok, tt.wantStart, tt.wantOK)
+		}
+	}
+}
+
+// hijackPartial writes a 200 response advertising len(body) as its Content-Length but only
+// sends the first partialLen bytes before closing the connection, simulating a connection
+// dropped partway through.
+func hijackPartial(t *testing.T, w http.ResponseWriter, body []byte, partialLen int) {
+	t.Helper()
+
+	// This runs on the server's handler goroutine, not the test's own goroutine, so failures
+	// are recorded with Errorf rather than Fatalf (which may only be called from the latter).
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		t.Errorf("ResponseWriter does not support hijacking")
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		t.Errorf("Hijack: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", len(body))
+	buf.Write(body[:partialLen])
+	buf.Flush()
+}
+
+func TestHTTPRangeReaderResumesAfterDrop(t *testing.T) {
+	full := []byte("hello range reader world, this is the full body")
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			hijackPartial(t, w, full, 5)
+		default:
+			if got := req.Header.Get("Range"); got != "bytes=5-" {
+				t.Errorf("got Range header %q, want %q", got, "bytes=5-")
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 5-%d/%d", len(full)-1, len(full)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(full[5:])
+		}
+	}))
+	defer srv.Close()
+
+	r := newHTTPRangeReader(context.Background(), srv.Client(), srv.URL)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != string(full) {
+		t.Fatalf("got %q, want %q", got, full)
+	}
+}
+
+func TestHTTPRangeReaderRejectsFullResponseOnResume(t *testing.T) {
+	full := []byte("0123456789")
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			hijackPartial(t, w, full, 3)
+		default:
+			// a server/proxy that ignores the Range header and re-sends the full body from
+			// the start: httpRangeReader must reject this rather than silently restarting
+			// the stream at offset 0.
+			w.WriteHeader(http.StatusOK)
+			w.Write(full)
+		}
+	}))
+	defer srv.Close()
+
+	r := newHTTPRangeReader(context.Background(), srv.Client(), srv.URL)
+	defer r.Close()
+
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("expected an error when the server ignores the Range header on resume")
+	}
+}
@@ -0,0 +1,135 @@
+package targzsize
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// EntryRecord is the structured representation of a single tar entry, as produced by the
+// JSON and NDJSON reporters.
+//
+// Typeflag is rendered as the single ASCII character tar itself uses (e.g. "0" for a regular
+// file, "5" for a directory) rather than its raw numeric byte value, so that it reads sensibly
+// in JSON output without consulting the tar format spec.
+type EntryRecord struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Typeflag string    `json:"typeflag"`
+	Mode     int64     `json:"mode"`
+	ModTime  time.Time `json:"mtime"`
+	Linkname string    `json:"linkname"`
+
+	// Layer is the OCI layer blob this entry survived in, as set on the originating Item.
+	// Omitted for archives that aren't OCI image layouts.
+	Layer string `json:"layer,omitempty"`
+}
+
+// LayerSummary aggregates the entries of a single OCI image layer that survived flattening,
+// i.e. that were neither overwritten by a later layer nor removed by a whiteout.
+//
+// Total is always the raw byte count, regardless of Scanner.Human, so that json/ndjson output
+// stays machine-readable (summable, comparable) for tools such as jq; humanization is a
+// text-reporter-only concern.
+type LayerSummary struct {
+	Digest string `json:"digest"`
+	Total  int64  `json:"total"`
+	Files  int    `json:"files"`
+}
+
+// ArchiveSummary aggregates the entries scanned within a single archive.
+//
+// Total is always the raw byte count, regardless of Scanner.Human; see LayerSummary for why.
+type ArchiveSummary struct {
+	Path      string `json:"path"`
+	Total     int64  `json:"total"`
+	Files     int    `json:"files"`
+	Symlinks  int    `json:"symlinks"`
+	Hardlinks int    `json:"hardlinks"`
+	Dirs      int    `json:"dirs"`
+	Unknown   int    `json:"unknown"`
+
+	// Layers breaks Total down by originating OCI layer. It is only populated for archives
+	// processed by ProcessOCIArchive.
+	Layers []LayerSummary `json:"layers,omitempty"`
+}
+
+// Reporter receives structured records as archives are scanned.
+// Scanner calls Entry once for every tar entry, and Summary once an archive has been fully
+// read.
+//
+// Implementations must be safe for concurrent use, since Scanner may be scanning several
+// archives at the same time.
+type Reporter interface {
+	Entry(path string, entry EntryRecord)
+	Summary(summary ArchiveSummary)
+}
+
+// jsonReporter collects the entries of each archive, and emits one JSON object per archive
+// once that archive has been fully scanned.
+type jsonReporter struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	entries map[string][]EntryRecord
+}
+
+// NewJSONReporter returns a Reporter that writes one JSON object per archive to w, each
+// containing the archive's summary alongside the full list of its entries.
+func NewJSONReporter(w io.Writer) Reporter {
+	return &jsonReporter{enc: json.NewEncoder(w), entries: make(map[string][]EntryRecord)}
+}
+
+func (r *jsonReporter) Entry(path string, entry EntryRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[path] = append(r.entries[path], entry)
+}
+
+func (r *jsonReporter) Summary(summary ArchiveSummary) {
+	r.mu.Lock()
+	entries := r.entries[summary.Path]
+	delete(r.entries, summary.Path)
+	r.mu.Unlock()
+
+	r.enc.Encode(struct {
+		ArchiveSummary
+		Entries []EntryRecord `json:"entries"`
+	}{summary, entries})
+}
+
+// ndjsonReporter streams one JSON record per tar entry as it is scanned, suitable for piping
+// into tools such as jq or a log ingestion pipeline. Each archive is terminated by a summary
+// record.
+type ndjsonReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewNDJSONReporter returns a Reporter that writes one newline-delimited JSON record per tar
+// entry to w as it is scanned, followed by a final summary record for each archive.
+func NewNDJSONReporter(w io.Writer) Reporter {
+	return &ndjsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *ndjsonReporter) Entry(path string, entry EntryRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.enc.Encode(struct {
+		Type  string      `json:"type"`
+		Path  string      `json:"path"`
+		Entry EntryRecord `json:"entry"`
+	}{"entry", path, entry})
+}
+
+func (r *ndjsonReporter) Summary(summary ArchiveSummary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.enc.Encode(struct {
+		Type string `json:"type"`
+		ArchiveSummary
+	}{"summary", summary})
+}
@@ -0,0 +1,196 @@
+package targzsize
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// Scanner processes multiple archives concurrently using a bounded worker pool, combining
+// their sizes into a single running total and rendering one status line per in-flight worker.
+type Scanner struct {
+	// Jobs is the maximum number of archives processed concurrently.
+	// A value <= 0 defaults to runtime.NumCPU().
+	Jobs int
+
+	// Format is the compression codec used to read every archive.
+	// FormatAuto, the default, detects the codec of each archive individually.
+	Format Format
+
+	// Silent suppresses the per-worker status lines when set.
+	Silent bool
+
+	// Human formats totals using human-readable units instead of raw byte counts.
+	Human bool
+
+	// Reporter, when set, additionally receives a structured record for every entry and a
+	// summary record for every archive.
+	Reporter Reporter
+
+	mu    sync.Mutex
+	total big.Int
+}
+
+// Total returns a copy of the combined total across all archives processed so far.
+func (s *Scanner) Total() *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return new(big.Int).Set(&s.total)
+}
+
+// add atomically adds delta to the running total and returns a copy of the new value.
+func (s *Scanner) add(delta int64) *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total.Add(&s.total, big.NewInt(delta))
+	return new(big.Int).Set(&s.total)
+}
+
+// jobs returns the effective worker pool size, bounded by the number of paths to process.
+func (s *Scanner) jobs(paths int) int {
+	jobs := s.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > paths {
+		jobs = paths
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	return jobs
+}
+
+// Run processes each of paths across the configured worker pool, adding their sizes to the
+// Scanner's running total. It returns the individual totals in the same order as paths,
+// regardless of the order in which the workers finish.
+//
+// As soon as any archive fails, ctx is cancelled so that the remaining workers stop reading
+// promptly; Run then returns the first error encountered.
+func (s *Scanner) Run(ctx context.Context, paths []string) ([]*big.Int, error) {
+	totals := make([]*big.Int, len(paths))
+
+	jobs := s.jobs(len(paths))
+	board := newStatusBoard(jobs, s.Silent)
+
+	slots := make(chan int, jobs)
+	for slot := 0; slot < jobs; slot++ {
+		slots <- slot
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(jobs)
+
+	for i, path := range paths {
+		i, path := i, path
+		g.Go(func() error {
+			slot := <-slots
+			defer func() { slots <- slot }()
+
+			total, err := s.scanOne(ctx, path, slot, board)
+			totals[i] = total
+			return err
+		})
+	}
+
+	err := g.Wait()
+	return totals, err
+}
+
+// scanOne processes a single archive, updating slot on board with its running total and
+// adding every item's size to the Scanner's combined total. When s.Reporter is set, it is
+// also fed an EntryRecord per item and a final ArchiveSummary.
+func (s *Scanner) scanOne(ctx context.Context, path string, slot int, board *statusBoard) (*big.Int, error) {
+	items := make(chan Item, chanBufferSize)
+	resultChan := openArchive(ctx, path, s.Format, items, s.Silent)
+
+	var fileTotal big.Int
+	var counts typeflagCounts
+	layers := make(map[string]*layerAgg)
+	var layerOrder []string
+	for item := range items {
+		fileTotal.Add(&fileTotal, big.NewInt(item.Size))
+		total := s.add(item.Size)
+		board.Update(slot, fmt.Sprintf("%s %q", TotalToString(total, s.Human), path))
+
+		if s.Reporter != nil {
+			counts.observe(item.Typeflag)
+			s.Reporter.Entry(path, item.toEntryRecord())
+
+			if item.Layer != "" {
+				agg, ok := layers[item.Layer]
+				if !ok {
+					agg = &layerAgg{}
+					layers[item.Layer] = agg
+					layerOrder = append(layerOrder, item.Layer)
+				}
+				agg.total.Add(&agg.total, big.NewInt(item.Size))
+				agg.files++
+			}
+		}
+	}
+	board.Clear(slot)
+
+	if s.Reporter != nil {
+		var layerSummaries []LayerSummary
+		for _, digest := range layerOrder {
+			agg := layers[digest]
+			layerSummaries = append(layerSummaries, LayerSummary{
+				Digest: digest,
+				Total:  agg.total.Int64(),
+				Files:  agg.files,
+			})
+		}
+
+		s.Reporter.Summary(ArchiveSummary{
+			Path:      path,
+			Total:     fileTotal.Int64(),
+			Files:     counts.files,
+			Symlinks:  counts.symlinks,
+			Hardlinks: counts.hardlinks,
+			Dirs:      counts.dirs,
+			Unknown:   counts.unknown,
+			Layers:    layerSummaries,
+		})
+	}
+
+	if err := <-resultChan; err != nil {
+		return &fileTotal, errors.Wrapf(err, "Unable to process %s", path)
+	}
+	return &fileTotal, nil
+}
+
+// layerAgg aggregates the size and file count of the entries of a single OCI layer, in the
+// order those entries were first encountered on the items channel.
+type layerAgg struct {
+	total big.Int
+	files int
+}
+
+// typeflagCounts aggregates the tar entry types seen within a single archive.
+type typeflagCounts struct {
+	files, symlinks, hardlinks, dirs, unknown int
+}
+
+func (c *typeflagCounts) observe(typeflag byte) {
+	switch typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		c.files++
+	case tar.TypeSymlink:
+		c.symlinks++
+	case tar.TypeLink:
+		c.hardlinks++
+	case tar.TypeDir:
+		c.dirs++
+	default:
+		c.unknown++
+	}
+}
@@ -0,0 +1,54 @@
+package targzsize
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// statusBoard renders one status line per in-flight worker to standard error.
+//
+// Every update redraws the whole board in place, moving the cursor back up to the first line
+// using ANSI cursor-up and erase-line escape sequences. It is safe for concurrent use.
+type statusBoard struct {
+	silent bool
+
+	mu    sync.Mutex
+	lines []string
+	drawn int
+}
+
+// newStatusBoard creates a statusBoard with capacity lines. When silent is true, all updates
+// are no-ops.
+func newStatusBoard(capacity int, silent bool) *statusBoard {
+	return &statusBoard{lines: make([]string, capacity), silent: silent}
+}
+
+// Update sets the text displayed on slot to text and redraws the board.
+func (b *statusBoard) Update(slot int, text string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lines[slot] = text
+	b.render()
+}
+
+// Clear blanks the text displayed on slot and redraws the board.
+func (b *statusBoard) Clear(slot int) {
+	b.Update(slot, "")
+}
+
+// render redraws every line. It must be called with mu held.
+func (b *statusBoard) render() {
+	if b.silent {
+		return
+	}
+
+	if b.drawn > 0 {
+		fmt.Fprintf(os.Stderr, "\033[%dA", b.drawn)
+	}
+	for _, line := range b.lines {
+		fmt.Fprintf(os.Stderr, "\033[2K\r%s\n", line)
+	}
+	b.drawn = len(b.lines)
+}